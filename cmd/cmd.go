@@ -3,13 +3,24 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/michaelwasher/kube-strace/pkg/kstrace"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes"
@@ -23,9 +34,31 @@ import (
 type KubeStraceCommandArgs struct {
 	traceImage      *string
 	traceTimeoutStr *string
-	socketPath      *string
 	logLevelStr     *string
 	outputDirectory *string
+
+	// Target resolution
+	selector      *string
+	allNamespaces *bool
+	maxPods       *int
+
+	// Execution
+	parallelism *int
+	follow      *bool
+
+	// Container selection
+	containers     *[]string
+	allContainers  *bool
+	initContainers *bool
+	pidFilter      *string
+
+	// Runtime selection. runtimeStr is "auto" unless the operator knows the
+	// runtime ahead of time; the socket overrides only apply once the
+	// matching runtime has been selected/detected.
+	runtimeStr           *string
+	crioSocketPath       *string
+	containerdSocketPath *string
+	dockerSocketPath     *string
 }
 type KubeStraceCommand struct {
 	KubeStraceCommandArgs
@@ -35,8 +68,10 @@ type KubeStraceCommand struct {
 	traceTimeout time.Duration
 
 	// Command state
-	tracers    []*kstrace.KStracer
-	targetPods []corev1.Pod
+	tracers             []*kstrace.KStracer
+	targetPods          []corev1.Pod
+	containerSelections map[types.UID][]string
+	pidFilterRegexp     *regexp.Regexp
 
 	// GenericCLI Options
 	clientset       *kubernetes.Clientset
@@ -49,13 +84,37 @@ func stringptr(val string) *string {
 	return &val
 }
 
+func boolptr(val bool) *bool {
+	return &val
+}
+
+func intptr(val int) *int {
+	return &val
+}
+
 func NewKubeStraceDefaults() KubeStraceCommandArgs {
 	return KubeStraceCommandArgs{
 		traceImage:      stringptr("quay.io/mwasher/crictl:0.0.2"),
-		socketPath:      stringptr("/run/crio/crio.sock"),
 		logLevelStr:     stringptr("info"),
 		traceTimeoutStr: stringptr("0"),
 		outputDirectory: stringptr("strace-collection"),
+
+		runtimeStr:           stringptr("auto"),
+		crioSocketPath:       stringptr(kstrace.DefaultSocketPathFor("crio")),
+		containerdSocketPath: stringptr(kstrace.DefaultSocketPathFor("containerd")),
+		dockerSocketPath:     stringptr(kstrace.DefaultSocketPathFor("docker")),
+
+		selector:      stringptr(""),
+		allNamespaces: boolptr(false),
+		maxPods:       intptr(20),
+
+		parallelism: intptr(0),
+		follow:      boolptr(false),
+
+		containers:     &[]string{},
+		allContainers:  boolptr(false),
+		initContainers: boolptr(false),
+		pidFilter:      stringptr(""),
 	}
 }
 
@@ -96,10 +155,22 @@ func NewKubeStraceCommand(applicationName string) *cobra.Command {
 	kCmd.kubeConfigFlags.AddFlags(flags)
 
 	// Add command-specific flags
-	flags.StringVar(kCmd.socketPath, "socket-path", *kCmd.socketPath, "The location of the CRI socket on the host machine.")
+	flags.StringVar(kCmd.runtimeStr, "runtime", *kCmd.runtimeStr, "The container runtime to use. One of auto|crio|containerd|docker.")
+	flags.StringVar(kCmd.crioSocketPath, "crio-socket-path", *kCmd.crioSocketPath, "The location of the CRI-O socket on the host machine.")
+	flags.StringVar(kCmd.containerdSocketPath, "containerd-socket-path", *kCmd.containerdSocketPath, "The location of the containerd socket on the host machine.")
+	flags.StringVar(kCmd.dockerSocketPath, "docker-socket-path", *kCmd.dockerSocketPath, "The location of the Docker socket on the host machine.")
 	flags.StringVar(kCmd.traceImage, "image", *kCmd.traceImage, "The trace image for use when performing the strace.")
 	flags.StringVar(kCmd.traceTimeoutStr, "trace-timeout", *kCmd.traceTimeoutStr, "The length of time to capture the strace output for.")
 	flags.StringVarP(kCmd.outputDirectory, "output", "o", *kCmd.outputDirectory, "The directory to store the strace data.")
+	flags.StringVarP(kCmd.selector, "selector", "l", *kCmd.selector, "Selector (label query) to filter the targeted resources, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2).")
+	flags.BoolVar(kCmd.allNamespaces, "all-namespaces", *kCmd.allNamespaces, "If present, list the targeted resources across all namespaces.")
+	flags.IntVar(kCmd.maxPods, "max-pods", *kCmd.maxPods, "The maximum number of Pods that may be targeted by a single invocation.")
+	flags.IntVar(kCmd.parallelism, "parallelism", *kCmd.parallelism, "The number of tracers to run concurrently. Defaults to one per targeted Pod.")
+	flags.BoolVarP(kCmd.follow, "follow", "f", *kCmd.follow, "Stream strace output from all targeted pods to stdout, prefixed by pod/container, instead of writing to --output.")
+	flags.StringArrayVarP(kCmd.containers, "container", "c", *kCmd.containers, "The container(s) to trace. May be repeated. Defaults to the pod's first container.")
+	flags.BoolVar(kCmd.allContainers, "all-containers", *kCmd.allContainers, "Trace every container in the targeted pod(s).")
+	flags.BoolVar(kCmd.initContainers, "init-containers", *kCmd.initContainers, "Include init containers when tracing every container; has no effect without --all-containers.")
+	flags.StringVar(kCmd.pidFilter, "pid-filter", *kCmd.pidFilter, "Regex matched against process comm names inside the traced container(s); only matching processes are strace'd.")
 
 	// LogLevels
 	logLevels := func() []string {
@@ -117,6 +188,13 @@ func NewKubeStraceCommand(applicationName string) *cobra.Command {
 	}()
 	flags.StringVar(kCmd.logLevelStr, "log-level", *kCmd.logLevelStr, fmt.Sprintf("The verbosity level of the output from the command. Available options are [%s].", strings.Join(logLevels, ", ")))
 
+	// Dynamic shell completion for Pod/workload names and the flags that
+	// reference them.
+	cmd.ValidArgsFunction = podAndWorkloadNameCompletion(kCmd)
+	_ = cmd.RegisterFlagCompletionFunc("container", containerNameCompletion(kCmd))
+	_ = cmd.RegisterFlagCompletionFunc("namespace", namespaceCompletion(kCmd))
+	_ = cmd.RegisterFlagCompletionFunc("log-level", logLevelCompletion(logLevels))
+
 	return cmd
 }
 
@@ -166,9 +244,16 @@ func (kCmd *KubeStraceCommand) Complete(cmd *cobra.Command, args []string) error
 		return err
 	}
 
+	if len(args) == 0 {
+		args = []string{"pods"}
+	}
+
 	kCmd.builder = f.NewBuilder().
 		WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
-		ResourceNames("pod", args...).NamespaceParam(namespace).DefaultNamespace()
+		NamespaceParam(namespace).DefaultNamespace().AllNamespaces(*kCmd.allNamespaces).
+		LabelSelectorParam(*kCmd.selector).
+		ResourceTypeOrNameArgs(true, args...).
+		Flatten()
 
 	return nil
 }
@@ -186,11 +271,33 @@ func (kCmd *KubeStraceCommand) Validate() error {
 	if len(kCmd.targetPods) < 1 {
 		return fmt.Errorf("a target pod must be defined")
 	}
-	if len(kCmd.targetPods) > 1 && *kCmd.outputDirectory == "-" {
-		return fmt.Errorf("cannot have multiple target pods but output to standard out")
+	if len(kCmd.targetPods) > *kCmd.maxPods {
+		return fmt.Errorf("%d pods matched the target resources, which exceeds --max-pods=%d; narrow the selector or raise --max-pods", len(kCmd.targetPods), *kCmd.maxPods)
 	}
-	if len(kCmd.targetPods[0].Spec.Containers) > 1 && *kCmd.outputDirectory == "-" {
-		return fmt.Errorf("there are multiple containers defined for pod %q. unable to output to standard out for pods with multiple containers", kCmd.targetPods[0].Name)
+	// Resolve which container(s) of each target pod to trace.
+	kCmd.containerSelections = map[types.UID][]string{}
+	for _, pod := range kCmd.targetPods {
+		containers, err := resolveContainers(pod, *kCmd.containers, *kCmd.allContainers, *kCmd.initContainers)
+		if err != nil {
+			return err
+		}
+		kCmd.containerSelections[pod.UID] = containers
+	}
+
+	if *kCmd.pidFilter != "" {
+		kCmd.pidFilterRegexp, err = regexp.Compile(*kCmd.pidFilter)
+		if err != nil {
+			return fmt.Errorf("invalid --pid-filter: %w", err)
+		}
+	}
+
+	if !*kCmd.follow {
+		if len(kCmd.targetPods) > 1 && *kCmd.outputDirectory == "-" {
+			return fmt.Errorf("cannot have multiple target pods but output to standard out")
+		}
+		if len(kCmd.containerSelections[kCmd.targetPods[0].UID]) > 1 && *kCmd.outputDirectory == "-" {
+			return fmt.Errorf("there are multiple containers selected for pod %q. unable to output to standard out for pods with multiple containers", kCmd.targetPods[0].Name)
+		}
 	}
 
 	kCmd.traceTimeout, err = time.ParseDuration(*kCmd.traceTimeoutStr)
@@ -201,62 +308,181 @@ func (kCmd *KubeStraceCommand) Validate() error {
 	return nil
 }
 
+// resolveContainers determines which of pod's containers should be traced,
+// based on the --container/--all-containers/--init-containers flags.
+func resolveContainers(pod corev1.Pod, names []string, allContainers, initContainers bool) ([]string, error) {
+	if allContainers {
+		containers := []string{}
+		for _, c := range pod.Spec.Containers {
+			containers = append(containers, c.Name)
+		}
+		if initContainers {
+			for _, c := range pod.Spec.InitContainers {
+				containers = append(containers, c.Name)
+			}
+		}
+		return containers, nil
+	}
+
+	if len(names) == 0 {
+		return []string{pod.Spec.Containers[0].Name}, nil
+	}
+
+	known := map[string]bool{}
+	for _, c := range pod.Spec.Containers {
+		known[c.Name] = true
+	}
+	for _, c := range pod.Spec.InitContainers {
+		known[c.Name] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("pod %q has no container named %q", pod.Name, name)
+		}
+	}
+
+	return names, nil
+}
+
 func (kCmd *KubeStraceCommand) Run() error {
-	var err error
-	ctx := context.TODO()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Create namespace for Strace Pods
 	ns, err := kstrace.CreateNamespace(ctx, kCmd.clientset)
-	defer kstrace.CleanupNamespace(ctx, kCmd.clientset, ns.Name)
-
 	if err != nil {
 		return err
 	}
+	defer kstrace.CleanupNamespace(context.Background(), kCmd.clientset, ns.Name)
 
-	// Create Tracers for each Pod
-	for _, targetPod := range kCmd.targetPods {
-		tracer := kstrace.NewKStracer(kCmd.clientset, kCmd.restConfig, *kCmd.traceImage, &targetPod, ns.Name, *kCmd.socketPath, kCmd.traceTimeout, *kCmd.outputDirectory)
-		kCmd.tracers = append(kCmd.tracers, tracer)
+	sockets := kstrace.RuntimeSocketPaths{
+		Crio:       *kCmd.crioSocketPath,
+		Containerd: *kCmd.containerdSocketPath,
+		Docker:     *kCmd.dockerSocketPath,
+	}
+
+	parallelism := *kCmd.parallelism
+	if parallelism <= 0 {
+		parallelism = len(kCmd.targetPods)
 	}
 
-	for _, tracer := range kCmd.tracers {
-		// TODO Place in goroutine
-		err = tracer.Start()
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(parallelism)
 
-		// Configure Cleanup
-		defer tracer.Cleanup()
-		defer tracer.Stop()
+	var stdoutMu sync.Mutex
 
+	// Create a Tracer per Pod and run them concurrently, each owning the
+	// full lifecycle (Start/Stop/Cleanup) of its own trace Pod.
+	for _, targetPod := range kCmd.targetPods {
+		targetPod := targetPod
+		containers := kCmd.containerSelections[targetPod.UID]
+
+		containerID := kstrace.ContainerIDFor(&targetPod, containers[0])
+		runtime, err := kstrace.NewRuntime(*kCmd.runtimeStr, containerID, sockets)
 		if err != nil {
-			return err
+			return fmt.Errorf("unable to resolve runtime for pod %q: %w", targetPod.Name, err)
+		}
+
+		tracer := kstrace.NewKStracer(kCmd.clientset, kCmd.restConfig, runtime, *kCmd.traceImage, &targetPod, containers, kCmd.pidFilterRegexp, ns.Name, kCmd.traceTimeout, *kCmd.outputDirectory)
+		kCmd.tracers = append(kCmd.tracers, tracer)
+
+		if *kCmd.follow {
+			prefix := fmt.Sprintf("[%s/%s] ", targetPod.Name, strings.Join(containers, ","))
+			tracer.SetOutput(newPrefixWriter(os.Stdout, &stdoutMu, prefix))
 		}
+
+		g.Go(func() error {
+			defer tracer.Cleanup()
+			defer tracer.Stop()
+
+			return tracer.Start(gctx)
+		})
 	}
 
-	return nil
+	return g.Wait()
 }
 
-func processResources(builder *resource.Builder, clientset *kubernetes.Clientset) ([]corev1.Pod, error) {
+func processResources(builder *resource.Builder, clientset kubernetes.Interface) ([]corev1.Pod, error) {
 	r := builder.Do()
 	podSlice := []corev1.Pod{}
+	seen := map[types.UID]bool{}
+
+	addPod := func(pod corev1.Pod) {
+		if seen[pod.UID] {
+			return
+		}
+		seen[pod.UID] = true
+		podSlice = append(podSlice, pod)
+	}
+
+	addPodsForSelector := func(namespace string, selector labels.Selector) error {
+		pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods.Items {
+			addPod(pod)
+		}
+		return nil
+	}
+
 	err := r.Visit(func(info *resource.Info, err error) error {
 		if err != nil {
 			// TODO(verb): configurable early return
 			return err
 		}
-		var visitErr error
 
 		switch obj := info.Object.(type) {
 
 		case *corev1.Pod:
 			log.Debugf("Adding pod to strace list %v", obj)
-			podSlice = append(podSlice, *obj)
+			addPod(*obj)
+
+		case *appsv1.Deployment:
+			selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+			if err != nil {
+				return err
+			}
+			return addPodsForSelector(obj.Namespace, selector)
+
+		case *appsv1.ReplicaSet:
+			selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+			if err != nil {
+				return err
+			}
+			return addPodsForSelector(obj.Namespace, selector)
+
+		case *appsv1.StatefulSet:
+			selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+			if err != nil {
+				return err
+			}
+			return addPodsForSelector(obj.Namespace, selector)
+
+		case *appsv1.DaemonSet:
+			selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+			if err != nil {
+				return err
+			}
+			return addPodsForSelector(obj.Namespace, selector)
+
+		case *batchv1.Job:
+			selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+			if err != nil {
+				return err
+			}
+			return addPodsForSelector(obj.Namespace, selector)
+
+		case *corev1.Service:
+			if len(obj.Spec.Selector) == 0 {
+				return fmt.Errorf("service %q has no selector, unable to resolve target pods", obj.Name)
+			}
+			return addPodsForSelector(obj.Namespace, labels.SelectorFromSet(obj.Spec.Selector))
 
 		default:
-			visitErr = fmt.Errorf("%q not supported by kstrace", info.Mapping.GroupVersionKind)
-		}
-		if visitErr != nil {
-			return visitErr
+			return fmt.Errorf("%q not supported by kstrace", info.Mapping.GroupVersionKind)
 		}
+
 		return nil
 	})
 	if err != nil {
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+)
+
+// completionClientset builds a clientset straight from the parsed kubeconfig
+// flags, without running Complete/Validate, so that shell completion stays
+// fast and doesn't depend on the full validation pipeline.
+func completionClientset(flags *genericclioptions.ConfigFlags) (*kubernetes.Clientset, string, error) {
+	restConfig, err := flags.ToRESTConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	namespace, _, err := flags.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return clientset, namespace, nil
+}
+
+func filterByPrefix(names []string, prefix string) []string {
+	matches := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// podAndWorkloadNameCompletion completes the first positional argument with
+// the names of Pods and the workload kinds processResources understands, in
+// the current namespace.
+func podAndWorkloadNameCompletion(kCmd *KubeStraceCommand) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		clientset, namespace, err := completionClientset(kCmd.kubeConfigFlags)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		ctx := context.Background()
+		names := []string{}
+
+		if pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+			for _, pod := range pods.Items {
+				names = append(names, pod.Name)
+			}
+		}
+		if deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+			for _, d := range deployments.Items {
+				names = append(names, "deployment/"+d.Name)
+			}
+		}
+		if daemonsets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+			for _, d := range daemonsets.Items {
+				names = append(names, "daemonset/"+d.Name)
+			}
+		}
+		if statefulsets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+			for _, s := range statefulsets.Items {
+				names = append(names, "statefulset/"+s.Name)
+			}
+		}
+		if replicasets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+			for _, r := range replicasets.Items {
+				names = append(names, "replicaset/"+r.Name)
+			}
+		}
+		if jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+			for _, j := range jobs.Items {
+				names = append(names, "job/"+j.Name)
+			}
+		}
+		if services, err := clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+			for _, s := range services.Items {
+				names = append(names, "service/"+s.Name)
+			}
+		}
+
+		return filterByPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// containerNameCompletion completes --container with the container and init
+// container names of the pod already typed as the first positional arg.
+func containerNameCompletion(kCmd *KubeStraceCommand) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		clientset, namespace, err := completionClientset(kCmd.kubeConfigFlags)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		pod, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), args[0], metav1.GetOptions{})
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		names := []string{}
+		for _, c := range pod.Spec.Containers {
+			names = append(names, c.Name)
+		}
+		for _, c := range pod.Spec.InitContainers {
+			names = append(names, c.Name)
+		}
+
+		return filterByPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// namespaceCompletion completes --namespace with the cluster's namespaces.
+func namespaceCompletion(kCmd *KubeStraceCommand) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		clientset, _, err := completionClientset(kCmd.kubeConfigFlags)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		namespaces, err := clientset.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		names := []string{}
+		for _, ns := range namespaces.Items {
+			names = append(names, ns.Name)
+		}
+
+		return filterByPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// logLevelCompletion completes --log-level with the statically known set of
+// logrus levels.
+func logLevelCompletion(logLevels []string) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return filterByPrefix(logLevels, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
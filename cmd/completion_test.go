@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterByPrefix(t *testing.T) {
+	names := []string{"web-abc", "web-def", "worker-1", "cache"}
+
+	got := filterByPrefix(names, "web")
+	want := []string{"web-abc", "web-def"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if got := filterByPrefix(names, ""); !reflect.DeepEqual(got, names) {
+		t.Fatalf("got %v, want %v", got, names)
+	}
+
+	if got := filterByPrefix(names, "nope"); len(got) != 0 {
+		t.Fatalf("got %v, want no matches", got)
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// prefixWriter prepends prefix to every complete line written to it before
+// forwarding to out, guarding out with mu so that concurrent tracers in
+// --follow mode don't interleave partial lines. Writes are not guaranteed
+// to land on line boundaries (the remotecommand executor streams arbitrary
+// chunks), so a line split across two Write calls is buffered in buf until
+// its terminating '\n' arrives.
+type prefixWriter struct {
+	out    io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func newPrefixWriter(out io.Writer, mu *sync.Mutex, prefix string) *prefixWriter {
+	return &prefixWriter{out: out, mu: mu, prefix: prefix}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+
+		line := w.buf[:idx]
+		w.buf = w.buf[idx+1:]
+
+		if _, err := io.WriteString(w.out, w.prefix+string(line)+"\n"); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes out any buffered partial line that never received a
+// terminating '\n'. Called once tracing ends so the last line isn't lost.
+func (w *prefixWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(w.out, w.prefix+string(w.buf)+"\n")
+	w.buf = nil
+	return err
+}
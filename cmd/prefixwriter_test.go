@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriterSplitLine(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	w := newPrefixWriter(&out, &mu, "[pod] ")
+
+	if _, err := w.Write([]byte("hello wor")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := w.Write([]byte("ld\nsecond line\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	want := "[pod] hello world\n[pod] second line\n"
+	if got := out.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPrefixWriterFlushesTrailingPartialLine(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	w := newPrefixWriter(&out, &mu, "[pod] ")
+
+	if _, err := w.Write([]byte("no trailing newline")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := "[pod] no trailing newline\n"
+	if got := out.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
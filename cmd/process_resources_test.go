@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	restfake "k8s.io/client-go/rest/fake"
+	"k8s.io/cli-runtime/pkg/resource"
+	cmdtesting "k8s.io/kubectl/pkg/cmd/testing"
+	"k8s.io/kubectl/pkg/scheme"
+)
+
+// newTestBuilder wires a resource.Builder whose REST requests are served from
+// objectsByPath, mirroring how kubectl's own command tests fake out the
+// Builder's REST client rather than hitting a real apiserver.
+func newTestBuilder(t *testing.T, namespace string, objectsByPath map[string]runtime.Object) *resource.Builder {
+	t.Helper()
+
+	tf := cmdtesting.NewTestFactory().WithNamespace(namespace)
+	t.Cleanup(tf.Cleanup)
+
+	codec := scheme.Codecs.LegacyCodec(scheme.Scheme.PrioritizedVersionsAllGroups()...)
+	tf.UnstructuredClient = &restfake.RESTClient{
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			obj, ok := objectsByPath[req.URL.Path]
+			if !ok {
+				t.Fatalf("unexpected request for %s", req.URL.Path)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Header: cmdtesting.DefaultHeader(), Body: cmdtesting.ObjBody(codec, obj)}, nil
+		}),
+	}
+
+	return tf.NewBuilder().
+		WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
+		NamespaceParam(namespace).DefaultNamespace()
+}
+
+func withLabels(pod corev1.Pod, labels map[string]string) corev1.Pod {
+	pod.Labels = labels
+	return pod
+}
+
+func TestProcessResourcesDeploymentResolvesToPods(t *testing.T) {
+	const namespace = "test"
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		},
+	}
+
+	pod := withLabels(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-abc", Namespace: namespace, UID: types.UID("web-abc")},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}, map[string]string{"app": "web"})
+
+	builder := newTestBuilder(t, namespace, map[string]runtime.Object{
+		fmt.Sprintf("/apis/apps/v1/namespaces/%s/deployments/web", namespace): deployment,
+	}).ResourceTypeOrNameArgs(true, "deployment/web").Flatten()
+
+	clientset := fakeclientset.NewSimpleClientset(&pod)
+
+	pods, err := processResources(builder, clientset)
+	if err != nil {
+		t.Fatalf("processResources: %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "web-abc" {
+		t.Fatalf("got %v, want [web-abc]", pods)
+	}
+}
+
+func TestProcessResourcesDedupesAcrossSelectors(t *testing.T) {
+	const namespace = "test"
+
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-rs", Namespace: namespace},
+		Spec: appsv1.ReplicaSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		},
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-svc", Namespace: namespace},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	}
+
+	pod := withLabels(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-abc", Namespace: namespace, UID: types.UID("web-abc")},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}, map[string]string{"app": "web"})
+
+	builder := newTestBuilder(t, namespace, map[string]runtime.Object{
+		fmt.Sprintf("/apis/apps/v1/namespaces/%s/replicasets/web-rs", namespace): replicaSet,
+		fmt.Sprintf("/api/v1/namespaces/%s/services/web-svc", namespace):         service,
+	}).ResourceTypeOrNameArgs(true, "replicaset/web-rs", "service/web-svc").Flatten()
+
+	clientset := fakeclientset.NewSimpleClientset(&pod)
+
+	pods, err := processResources(builder, clientset)
+	if err != nil {
+		t.Fatalf("processResources: %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "web-abc" {
+		t.Fatalf("got %v, want a single de-duplicated [web-abc]", pods)
+	}
+}
+
+func TestProcessResourcesServiceWithoutSelectorErrors(t *testing.T) {
+	const namespace = "test"
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "headless", Namespace: namespace},
+	}
+
+	builder := newTestBuilder(t, namespace, map[string]runtime.Object{
+		fmt.Sprintf("/api/v1/namespaces/%s/services/headless", namespace): service,
+	}).ResourceTypeOrNameArgs(true, "service/headless").Flatten()
+
+	clientset := fakeclientset.NewSimpleClientset()
+
+	_, err := processResources(builder, clientset)
+	if err == nil || !strings.Contains(err.Error(), "no selector") {
+		t.Fatalf("got error %v, want one mentioning the missing selector", err)
+	}
+}
+
+func TestValidateEnforcesMaxPods(t *testing.T) {
+	const namespace = "test"
+
+	podA := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: namespace, UID: types.UID("a")},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	podB := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: namespace, UID: types.UID("b")},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+
+	builder := newTestBuilder(t, namespace, map[string]runtime.Object{
+		fmt.Sprintf("/api/v1/namespaces/%s/pods/a", namespace): &podA,
+		fmt.Sprintf("/api/v1/namespaces/%s/pods/b", namespace): &podB,
+	}).ResourceTypeOrNameArgs(true, "pod/a", "pod/b").Flatten()
+
+	kCmd := &KubeStraceCommand{KubeStraceCommandArgs: NewKubeStraceDefaults()}
+	kCmd.builder = builder
+	kCmd.maxPods = intptr(1)
+
+	err := kCmd.Validate()
+	if err == nil || !strings.Contains(err.Error(), "exceeds --max-pods") {
+		t.Fatalf("got error %v, want the --max-pods guard to fire", err)
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func testPod() corev1.Pod {
+	return corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "app"},
+				{Name: "sidecar"},
+			},
+			InitContainers: []corev1.Container{
+				{Name: "init"},
+			},
+		},
+	}
+}
+
+func TestResolveContainersDefaultsToFirstContainer(t *testing.T) {
+	got, err := resolveContainers(testPod(), nil, false, false)
+	if err != nil {
+		t.Fatalf("resolveContainers: %v", err)
+	}
+	if want := []string{"app"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestResolveContainersExplicitNames(t *testing.T) {
+	got, err := resolveContainers(testPod(), []string{"sidecar", "init"}, false, false)
+	if err != nil {
+		t.Fatalf("resolveContainers: %v", err)
+	}
+	if want := []string{"sidecar", "init"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestResolveContainersUnknownName(t *testing.T) {
+	if _, err := resolveContainers(testPod(), []string{"does-not-exist"}, false, false); err == nil {
+		t.Fatal("expected an error for an unknown container name")
+	}
+}
+
+func TestResolveContainersAllContainers(t *testing.T) {
+	got, err := resolveContainers(testPod(), nil, true, false)
+	if err != nil {
+		t.Fatalf("resolveContainers: %v", err)
+	}
+	if want := []string{"app", "sidecar"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestResolveContainersAllContainersWithInit(t *testing.T) {
+	got, err := resolveContainers(testPod(), nil, true, true)
+	if err != nil {
+		t.Fatalf("resolveContainers: %v", err)
+	}
+	if want := []string{"app", "sidecar", "init"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
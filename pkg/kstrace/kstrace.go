@@ -0,0 +1,354 @@
+package kstrace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// tracePodPrefix names the Pod kstrace creates on the target Node to run
+// strace from. It runs in the Node's host PID namespace so that strace can
+// attach to the resolved PID directly.
+const tracePodPrefix = "kstrace-"
+
+// KStracer drives a single strace session against one Pod: it schedules a
+// helper Pod on the same Node, resolves the target container's init PID via
+// the configured Runtime, and streams `strace -p <pid>` output to either a
+// file under outputDirectory or, when outputDirectory is "-", stdout.
+type KStracer struct {
+	clientset  *kubernetes.Clientset
+	restConfig *rest.Config
+
+	runtime         Runtime
+	traceImage      string
+	targetPod       *corev1.Pod
+	containers      []string
+	pidFilter       *regexp.Regexp
+	namespace       string
+	traceTimeout    time.Duration
+	outputDirectory string
+
+	// output, when set via SetOutput, overrides outputDirectory as the
+	// destination for strace output (used by --follow).
+	output io.Writer
+
+	stracePod *corev1.Pod
+}
+
+// SetOutput redirects strace output to w instead of a file under
+// outputDirectory or stdout, bypassing --output entirely. Used by --follow
+// to stream into a single, prefixed writer shared by every tracer.
+func (k *KStracer) SetOutput(w io.Writer) {
+	k.output = w
+}
+
+// NewKStracer constructs a KStracer for targetPod. The supplied Runtime is
+// used both to mount the correct host socket into the trace Pod and to
+// resolve the init PID of each container in containers. pidFilter, if
+// non-nil, narrows the traced PIDs to processes whose comm name it matches.
+func NewKStracer(clientset *kubernetes.Clientset, restConfig *rest.Config, runtime Runtime, traceImage string, targetPod *corev1.Pod, containers []string, pidFilter *regexp.Regexp, namespace string, traceTimeout time.Duration, outputDirectory string) *KStracer {
+	return &KStracer{
+		clientset:       clientset,
+		restConfig:      restConfig,
+		runtime:         runtime,
+		traceImage:      traceImage,
+		targetPod:       targetPod,
+		containers:      containers,
+		pidFilter:       pidFilter,
+		namespace:       namespace,
+		traceTimeout:    traceTimeout,
+		outputDirectory: outputDirectory,
+	}
+}
+
+// Start schedules the trace Pod, waits for it to become ready, resolves the
+// target container's PID and begins streaming strace output. It returns
+// once tracing ends, either because ctx was cancelled or the strace process
+// exited (e.g. --trace-timeout elapsed).
+func (k *KStracer) Start(ctx context.Context) error {
+	log.Infof("Starting tracer for pod %s/%s using runtime %q", k.targetPod.Namespace, k.targetPod.Name, k.runtime.Name())
+
+	pod, err := k.clientset.CoreV1().Pods(k.namespace).Create(ctx, k.buildTracePod(), metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create trace pod: %w", err)
+	}
+	k.stracePod = pod
+
+	if err := k.waitForRunning(ctx); err != nil {
+		return err
+	}
+
+	pids := []int{}
+	for _, containerName := range k.containers {
+		containerID := ContainerIDFor(k.targetPod, containerName)
+		if containerID == "" {
+			return fmt.Errorf("container %q on pod %q has no containerID yet", containerName, k.targetPod.Name)
+		}
+
+		pid, err := k.resolvePID(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		pids = append(pids, pid)
+	}
+
+	if k.pidFilter != nil {
+		filtered, err := k.filterPIDsByComm(ctx, pids)
+		if err != nil {
+			return err
+		}
+		if len(filtered) == 0 {
+			return fmt.Errorf("no processes in pod %q matched --pid-filter %q", k.targetPod.Name, k.pidFilter.String())
+		}
+		pids = filtered
+	}
+
+	return k.runStrace(ctx, pids)
+}
+
+// Stop signals the running strace process to terminate by deleting the
+// trace Pod, which tears down the strace process started within it.
+func (k *KStracer) Stop() error {
+	if k.stracePod == nil {
+		return nil
+	}
+
+	log.Debugf("Stopping tracer pod %s/%s", k.stracePod.Namespace, k.stracePod.Name)
+	return k.clientset.CoreV1().Pods(k.stracePod.Namespace).Delete(context.TODO(), k.stracePod.Name, metav1.DeleteOptions{})
+}
+
+// Cleanup releases any local resources held by the tracer. The trace Pod
+// itself is removed by the caller alongside the rest of the kstrace
+// namespace.
+func (k *KStracer) Cleanup() error {
+	return nil
+}
+
+func (k *KStracer) buildTracePod() *corev1.Pod {
+	hostPathSocket := corev1.HostPathSocket
+	privileged := true
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: tracePodPrefix,
+			Namespace:    k.namespace,
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      k.targetPod.Spec.NodeName,
+			RestartPolicy: corev1.RestartPolicyNever,
+			HostPID:       true,
+			Containers: []corev1.Container{
+				{
+					Name:    "kstrace",
+					Image:   k.traceImage,
+					Command: []string{"sleep", "infinity"},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: &privileged,
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "cri-socket",
+							MountPath: k.runtime.SocketPath(),
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "cri-socket",
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{
+							Path: k.runtime.SocketPath(),
+							Type: &hostPathSocket,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (k *KStracer) waitForRunning(ctx context.Context) error {
+	return wait(ctx, 30*time.Second, func() (bool, error) {
+		pod, err := k.clientset.CoreV1().Pods(k.stracePod.Namespace).Get(ctx, k.stracePod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return pod.Status.Phase == corev1.PodRunning, nil
+	})
+}
+
+func (k *KStracer) resolvePID(ctx context.Context, containerID string) (int, error) {
+	var stdout, stderr bytes.Buffer
+
+	if err := k.exec(ctx, k.runtime.InspectCommand(containerID), &stdout, &stderr); err != nil {
+		return 0, fmt.Errorf("failed to inspect container %q: %w: %s", containerID, err, stderr.String())
+	}
+
+	return k.runtime.ParsePID(stdout.Bytes())
+}
+
+// runStrace attaches to every PID in pids with a single strace invocation,
+// following forks with -f so that children of a traced init process are
+// picked up automatically.
+func (k *KStracer) runStrace(ctx context.Context, pids []int) error {
+	out, closeOutput, err := k.openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	cmd := []string{"strace", "-f"}
+	for _, pid := range pids {
+		cmd = append(cmd, "-p", strconv.Itoa(pid))
+	}
+	if k.traceTimeout > 0 {
+		cmd = append([]string{"timeout", k.traceTimeout.String()}, cmd...)
+	}
+
+	return k.exec(ctx, cmd, out, out)
+}
+
+// psProcess is one row of `ps -eo pid,ppid,comm` output inside the strace
+// Pod's (node-wide, since the Pod runs with HostPID) PID namespace.
+type psProcess struct {
+	pid, ppid int
+	comm      string
+}
+
+// parsePSOutput parses the output of `ps -eo pid,ppid,comm`, skipping the
+// header line and any row it can't read.
+func parsePSOutput(output []byte) []psProcess {
+	procs := []psProcess{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+
+		procs = append(procs, psProcess{pid: pid, ppid: ppid, comm: strings.Join(fields[2:], " ")})
+	}
+
+	return procs
+}
+
+// descendantComms walks procs from each of roots down through child
+// processes (by ppid) and returns the comm name of every PID in the
+// resulting subtrees, keyed by PID. roots are always included.
+func descendantComms(procs []psProcess, roots []int) map[int]string {
+	children := map[int][]int{}
+	comms := map[int]string{}
+	for _, p := range procs {
+		children[p.ppid] = append(children[p.ppid], p.pid)
+		comms[p.pid] = p.comm
+	}
+
+	result := map[int]string{}
+	queue := append([]int{}, roots...)
+	for _, pid := range roots {
+		result[pid] = comms[pid]
+	}
+
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+
+		for _, child := range children[pid] {
+			if _, seen := result[child]; seen {
+				continue
+			}
+			result[child] = comms[child]
+			queue = append(queue, child)
+		}
+	}
+
+	return result
+}
+
+// filterPIDsByComm restricts the process tree rooted at roots (the init
+// PIDs of the selected containers) to the PIDs whose comm name matches
+// k.pidFilter. Scoping to the roots' descendants matters because the
+// strace Pod runs with HostPID and would otherwise see every process on
+// the node, not just those belonging to the targeted container(s).
+func (k *KStracer) filterPIDsByComm(ctx context.Context, roots []int) ([]int, error) {
+	var stdout, stderr bytes.Buffer
+
+	if err := k.exec(ctx, []string{"ps", "-eo", "pid,ppid,comm"}, &stdout, &stderr); err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w: %s", err, stderr.String())
+	}
+
+	procs := parsePSOutput(stdout.Bytes())
+	comms := descendantComms(procs, roots)
+
+	pids := []int{}
+	for pid, comm := range comms {
+		if k.pidFilter.MatchString(comm) {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+
+	return pids, nil
+}
+
+// openOutput resolves where strace output should be written, along with a
+// closer to release any file it opened. The returned closer is always safe
+// to call.
+func (k *KStracer) openOutput() (io.Writer, func(), error) {
+	if k.output != nil {
+		return k.output, func() {
+			if f, ok := k.output.(interface{ Flush() error }); ok {
+				if err := f.Flush(); err != nil {
+					log.Warnf("failed to flush trailing output for pod %q: %v", k.targetPod.Name, err)
+				}
+			}
+		}, nil
+	}
+
+	if k.outputDirectory == "-" {
+		return os.Stdout, func() {}, nil
+	}
+
+	if err := os.MkdirAll(k.outputDirectory, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create output directory %q: %w", k.outputDirectory, err)
+	}
+
+	path := filepath.Join(k.outputDirectory, fmt.Sprintf("%s.strace", k.targetPod.Name))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, func() { f.Close() }, nil
+}
+
+// exec runs command inside the trace Pod via the remotecommand executor.
+func (k *KStracer) exec(ctx context.Context, command []string, stdout, stderr io.Writer) error {
+	return execInPod(ctx, k.clientset, k.restConfig, k.stracePod.Namespace, k.stracePod.Name, "kstrace", command, stdout, stderr)
+}
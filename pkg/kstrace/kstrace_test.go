@@ -0,0 +1,45 @@
+package kstrace
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePSOutput(t *testing.T) {
+	output := []byte("  PID  PPID COMMAND\n" +
+		"    1     0 sh\n" +
+		"   42     1 nginx\n" +
+		"   43    42 nginx-worker\n" +
+		"   99     1 sidecar\n")
+
+	got := parsePSOutput(output)
+	want := []psProcess{
+		{pid: 1, ppid: 0, comm: "sh"},
+		{pid: 42, ppid: 1, comm: "nginx"},
+		{pid: 43, ppid: 42, comm: "nginx-worker"},
+		{pid: 99, ppid: 1, comm: "sidecar"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDescendantComms(t *testing.T) {
+	procs := []psProcess{
+		{pid: 1, ppid: 0, comm: "sh"},
+		{pid: 42, ppid: 1, comm: "nginx"},
+		{pid: 43, ppid: 42, comm: "nginx-worker"},
+		{pid: 99, ppid: 1, comm: "sidecar"},
+	}
+
+	// Rooted at the "nginx" container's init PID (42), "sidecar" (99,
+	// a sibling under a different container's init PID 1) must not appear,
+	// even though it's visible node-wide via the shared HostPID namespace.
+	got := descendantComms(procs, []int{42})
+	want := map[int]string{42: "nginx", 43: "nginx-worker"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
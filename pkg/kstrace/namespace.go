@@ -0,0 +1,48 @@
+package kstrace
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespacePrefix is used to generate a unique namespace for each kstrace
+// invocation so that trace Pods never collide with existing cluster state.
+const namespacePrefix = "kstrace-"
+
+// CreateNamespace provisions a throwaway Namespace in which the strace Pods
+// for this invocation will be created.
+func CreateNamespace(ctx context.Context, clientset *kubernetes.Clientset) (*corev1.Namespace, error) {
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: namespacePrefix,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "kstrace",
+			},
+		},
+	}
+
+	created, err := clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kstrace namespace: %w", err)
+	}
+
+	return created, nil
+}
+
+// CleanupNamespace removes the Namespace created by CreateNamespace, along
+// with every strace Pod it contains.
+func CleanupNamespace(ctx context.Context, clientset *kubernetes.Clientset, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	if err := clientset.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to cleanup kstrace namespace %q: %w", name, err)
+	}
+
+	return nil
+}
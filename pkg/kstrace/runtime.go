@@ -0,0 +1,171 @@
+package kstrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Runtime abstracts over the container engine running on a Node so that the
+// tracer can mount the right socket into the strace Pod and resolve a
+// container's init PID regardless of which CRI implementation the cluster
+// uses.
+type Runtime interface {
+	// Name is the value accepted by the --runtime flag (e.g. "crio").
+	Name() string
+	// SocketPath is the host path of this runtime's control socket, bind
+	// mounted into the strace Pod at the same path.
+	SocketPath() string
+	// InspectCommand returns the argv to run inside the strace Pod to
+	// resolve containerID's init PID.
+	InspectCommand(containerID string) []string
+	// ParsePID extracts the init PID from the output of InspectCommand.
+	ParsePID(output []byte) (int, error)
+}
+
+// crioRuntime drives CRI-O via crictl.
+type crioRuntime struct{ socketPath string }
+
+func (r crioRuntime) Name() string       { return "crio" }
+func (r crioRuntime) SocketPath() string { return r.socketPath }
+func (r crioRuntime) InspectCommand(containerID string) []string {
+	return []string{"crictl", "--runtime-endpoint", "unix://" + r.socketPath, "inspect", containerID}
+}
+func (r crioRuntime) ParsePID(output []byte) (int, error) {
+	return parseCrictlPID(output)
+}
+
+// containerdRuntime drives containerd via ctr.
+type containerdRuntime struct{ socketPath string }
+
+func (r containerdRuntime) Name() string       { return "containerd" }
+func (r containerdRuntime) SocketPath() string { return r.socketPath }
+func (r containerdRuntime) InspectCommand(containerID string) []string {
+	return []string{"ctr", "-n", "k8s.io", "-a", r.socketPath, "containers", "info", containerID}
+}
+func (r containerdRuntime) ParsePID(output []byte) (int, error) {
+	return parseCrictlPID(output)
+}
+
+// dockerRuntime drives the legacy dockershim/Docker Engine.
+type dockerRuntime struct{ socketPath string }
+
+func (r dockerRuntime) Name() string       { return "docker" }
+func (r dockerRuntime) SocketPath() string { return r.socketPath }
+func (r dockerRuntime) InspectCommand(containerID string) []string {
+	return []string{"docker", "--host", "unix://" + r.socketPath, "inspect", "--format", "{{.State.Pid}}", containerID}
+}
+func (r dockerRuntime) ParsePID(output []byte) (int, error) {
+	pid, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse docker inspect output %q: %w", output, err)
+	}
+	return pid, nil
+}
+
+// parseCrictlPID extracts the `.info.pid` field shared by `crictl inspect`
+// and `ctr containers info` JSON output.
+func parseCrictlPID(output []byte) (int, error) {
+	var inspect struct {
+		Info struct {
+			Pid int `json:"pid"`
+		} `json:"info"`
+	}
+
+	if err := json.NewDecoder(bytes.NewReader(output)).Decode(&inspect); err != nil {
+		return 0, fmt.Errorf("unable to parse runtime inspect output: %w", err)
+	}
+	if inspect.Info.Pid == 0 {
+		return 0, fmt.Errorf("runtime inspect output did not contain a pid")
+	}
+
+	return inspect.Info.Pid, nil
+}
+
+// defaultSocketPaths are the well-known host socket locations per runtime,
+// used to seed the --<runtime>-socket-path flag defaults and as a fallback
+// when no override is given.
+var defaultSocketPaths = map[string]string{
+	"crio":       "/run/crio/crio.sock",
+	"containerd": "/run/containerd/containerd.sock",
+	"docker":     "/var/run/docker.sock",
+}
+
+// containerIDPrefixes maps the scheme prefix Kubernetes reports in
+// status.containerStatuses[].containerID to the Runtime name that produced
+// it.
+var containerIDPrefixes = map[string]string{
+	"cri-o":      "crio",
+	"containerd": "containerd",
+	"docker":     "docker",
+}
+
+// DefaultSocketPathFor returns the well-known host socket path for the named
+// runtime, used to seed the --<runtime>-socket-path flag defaults.
+func DefaultSocketPathFor(name string) string {
+	return defaultSocketPaths[name]
+}
+
+// RuntimeSocketPaths carries the (possibly overridden) socket path for each
+// supported runtime, as configured via --crio-socket-path,
+// --containerd-socket-path and --docker-socket-path.
+type RuntimeSocketPaths struct {
+	Crio       string
+	Containerd string
+	Docker     string
+}
+
+func newRuntimeByName(name string, sockets RuntimeSocketPaths) (Runtime, error) {
+	switch name {
+	case "crio":
+		return crioRuntime{socketPath: sockets.Crio}, nil
+	case "containerd":
+		return containerdRuntime{socketPath: sockets.Containerd}, nil
+	case "docker":
+		return dockerRuntime{socketPath: sockets.Docker}, nil
+	default:
+		return nil, fmt.Errorf("unknown runtime %q: must be one of auto|crio|containerd|docker", name)
+	}
+}
+
+// NewRuntime resolves a Runtime by its --runtime flag value. name may be
+// "auto", in which case containerID (e.g. "containerd://<id>") is used to
+// detect the runtime that owns the container.
+func NewRuntime(name string, containerID string, sockets RuntimeSocketPaths) (Runtime, error) {
+	if name != "auto" {
+		return newRuntimeByName(name, sockets)
+	}
+
+	prefix, _, ok := strings.Cut(containerID, "://")
+	if !ok {
+		return nil, fmt.Errorf("unable to detect runtime: malformed containerID %q", containerID)
+	}
+
+	rtName, ok := containerIDPrefixes[prefix]
+	if !ok {
+		return nil, fmt.Errorf("unable to detect runtime from containerID %q", containerID)
+	}
+
+	return newRuntimeByName(rtName, sockets)
+}
+
+// ContainerIDFor returns the raw containerID (e.g. "containerd://<id>") that
+// Kubernetes recorded for containerName across a Pod's regular and init
+// container statuses, or "" if the container has not yet reported a status.
+func ContainerIDFor(pod *corev1.Pod, containerName string) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName {
+			return status.ContainerID
+		}
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name == containerName {
+			return status.ContainerID
+		}
+	}
+	return ""
+}
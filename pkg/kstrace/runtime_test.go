@@ -0,0 +1,122 @@
+package kstrace
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewRuntimeAuto(t *testing.T) {
+	sockets := RuntimeSocketPaths{Crio: "/a.sock", Containerd: "/b.sock", Docker: "/c.sock"}
+
+	rt, err := NewRuntime("auto", "containerd://abc123", sockets)
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+	if rt.Name() != "containerd" {
+		t.Fatalf("got runtime %q, want containerd", rt.Name())
+	}
+	if rt.SocketPath() != "/b.sock" {
+		t.Fatalf("got socket %q, want /b.sock", rt.SocketPath())
+	}
+}
+
+func TestNewRuntimeAutoCRIO(t *testing.T) {
+	sockets := RuntimeSocketPaths{Crio: "/a.sock"}
+
+	rt, err := NewRuntime("auto", "cri-o://abc123", sockets)
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+	if rt.Name() != "crio" {
+		t.Fatalf("got runtime %q, want crio", rt.Name())
+	}
+}
+
+func TestNewRuntimeAutoMalformedContainerID(t *testing.T) {
+	if _, err := NewRuntime("auto", "abc123", RuntimeSocketPaths{}); err == nil {
+		t.Fatal("expected an error for a containerID with no runtime prefix")
+	}
+}
+
+func TestNewRuntimeAutoUnknownPrefix(t *testing.T) {
+	if _, err := NewRuntime("auto", "rkt://abc123", RuntimeSocketPaths{}); err == nil {
+		t.Fatal("expected an error for an unrecognized containerID prefix")
+	}
+}
+
+func TestNewRuntimeExplicit(t *testing.T) {
+	sockets := RuntimeSocketPaths{Docker: "/custom/docker.sock"}
+
+	rt, err := NewRuntime("docker", "", sockets)
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+	if rt.SocketPath() != "/custom/docker.sock" {
+		t.Fatalf("got socket %q, want /custom/docker.sock", rt.SocketPath())
+	}
+}
+
+func TestParseCrictlPID(t *testing.T) {
+	rt := containerdRuntime{}
+
+	pid, err := rt.ParsePID([]byte(`{"info":{"pid":4242}}`))
+	if err != nil {
+		t.Fatalf("ParsePID: %v", err)
+	}
+	if pid != 4242 {
+		t.Fatalf("got pid %d, want 4242", pid)
+	}
+
+	if _, err := rt.ParsePID([]byte(`{"info":{}}`)); err == nil {
+		t.Fatal("expected an error when pid is missing")
+	}
+}
+
+func TestDockerRuntimeParsePID(t *testing.T) {
+	rt := dockerRuntime{}
+
+	pid, err := rt.ParsePID([]byte("4242\n"))
+	if err != nil {
+		t.Fatalf("ParsePID: %v", err)
+	}
+	if pid != 4242 {
+		t.Fatalf("got pid %d, want 4242", pid)
+	}
+
+	if _, err := rt.ParsePID([]byte("<no value>")); err == nil {
+		t.Fatal("expected an error for non-numeric docker inspect output")
+	}
+}
+
+func TestDefaultSocketPathFor(t *testing.T) {
+	if got, want := DefaultSocketPathFor("crio"), "/run/crio/crio.sock"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := DefaultSocketPathFor("unknown"); got != "" {
+		t.Fatalf("got %q, want empty string for an unrecognized runtime", got)
+	}
+}
+
+func TestContainerIDFor(t *testing.T) {
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", ContainerID: "containerd://app123"},
+			},
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "init", ContainerID: "containerd://init123"},
+			},
+		},
+	}
+
+	if got, want := ContainerIDFor(pod, "app"), "containerd://app123"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got, want := ContainerIDFor(pod, "init"), "containerd://init123"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := ContainerIDFor(pod, "missing"); got != "" {
+		t.Fatalf("got %q, want empty string for a container with no status yet", got)
+	}
+}